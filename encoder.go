@@ -0,0 +1,146 @@
+package main
+
+import "fmt"
+
+// Encoder describes an output audio format the service can produce.
+// FFmpegArgs returns the ffmpeg arguments needed to produce that format
+// at the given sample rate and channel count; any format-specific
+// parameters (VBR quality, bitrate, ...) are baked into the Encoder
+// value itself when it's resolved.
+type Encoder interface {
+	Name() string
+	FFmpegArgs(sampleRate, channels int) []string
+	Ext() string
+	MIME() string
+}
+
+type wavEncoder struct{}
+
+func (wavEncoder) Name() string { return "wav" }
+func (wavEncoder) Ext() string  { return ".wav" }
+func (wavEncoder) MIME() string { return "audio/wav" }
+func (wavEncoder) FFmpegArgs(sampleRate, channels int) []string {
+	return []string{
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-ac", fmt.Sprintf("%d", channels),
+		"-sample_fmt", "s16",
+		"-f", "wav",
+	}
+}
+
+// mp3Encoder produces libmp3lame VBR output. VBRQuality follows ffmpeg's
+// -q:a scale: 0 is highest quality/largest file, 9 is lowest/smallest.
+type mp3Encoder struct {
+	VBRQuality int
+}
+
+func (mp3Encoder) Name() string { return "mp3" }
+func (mp3Encoder) Ext() string  { return ".mp3" }
+func (mp3Encoder) MIME() string { return "audio/mpeg" }
+func (e mp3Encoder) FFmpegArgs(sampleRate, channels int) []string {
+	return []string{
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-ac", fmt.Sprintf("%d", channels),
+		"-c:a", "libmp3lame",
+		"-q:a", fmt.Sprintf("%d", e.VBRQuality),
+		"-f", "mp3",
+	}
+}
+
+type flacEncoder struct{}
+
+func (flacEncoder) Name() string { return "flac" }
+func (flacEncoder) Ext() string  { return ".flac" }
+func (flacEncoder) MIME() string { return "audio/flac" }
+func (flacEncoder) FFmpegArgs(sampleRate, channels int) []string {
+	return []string{
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-ac", fmt.Sprintf("%d", channels),
+		"-c:a", "flac",
+		"-f", "flac",
+	}
+}
+
+// opusEncoder produces libopus output at a fixed target bitrate (CBR-ish
+// VBR is ffmpeg's default for libopus).
+type opusEncoder struct {
+	BitrateKbps int
+}
+
+func (opusEncoder) Name() string { return "opus" }
+func (opusEncoder) Ext() string  { return ".opus" }
+func (opusEncoder) MIME() string { return "audio/opus" }
+func (e opusEncoder) FFmpegArgs(sampleRate, channels int) []string {
+	return []string{
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-ac", fmt.Sprintf("%d", channels),
+		"-c:a", "libopus",
+		"-b:a", fmt.Sprintf("%dk", e.BitrateKbps),
+		"-f", "opus",
+	}
+}
+
+const (
+	defaultMP3Quality  = 4
+	defaultOpusBitrate = 64
+)
+
+// resolveEncoder maps a requested target format name to an Encoder,
+// applying bitrate as VBR quality (mp3) or kbps bitrate (opus). An empty
+// name defaults to wav.
+func resolveEncoder(name string, bitrate int) (Encoder, error) {
+	switch name {
+	case "", "wav":
+		return wavEncoder{}, nil
+	case "mp3":
+		q := defaultMP3Quality
+		if bitrate != 0 {
+			if bitrate < 0 || bitrate > 9 {
+				return nil, fmt.Errorf("mp3 bitrate must be a VBR quality between 0 and 9")
+			}
+			q = bitrate
+		}
+		return mp3Encoder{VBRQuality: q}, nil
+	case "flac":
+		return flacEncoder{}, nil
+	case "opus":
+		kbps := defaultOpusBitrate
+		if bitrate > 0 {
+			kbps = bitrate
+		}
+		return opusEncoder{BitrateKbps: kbps}, nil
+	default:
+		return nil, fmt.Errorf("unsupported target format %q", name)
+	}
+}
+
+// encoderNameFromMIME maps an Accept header value to a target format
+// name, for clients that prefer content negotiation over the `target`
+// form field.
+func encoderNameFromMIME(mime string) string {
+	switch mime {
+	case "audio/mpeg", "audio/mp3":
+		return "mp3"
+	case "audio/flac", "audio/x-flac":
+		return "flac"
+	case "audio/opus", "audio/ogg":
+		return "opus"
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return "wav"
+	default:
+		return ""
+	}
+}
+
+// encoderFingerprint identifies an encoder configuration for cache-key
+// purposes, so differing targets/params don't collide in StorageDir.
+func encoderFingerprint(enc Encoder, sampleRate, channels int) string {
+	param := ""
+	switch e := enc.(type) {
+	case mp3Encoder:
+		param = fmt.Sprintf("q%d", e.VBRQuality)
+	case opusEncoder:
+		param = fmt.Sprintf("b%d", e.BitrateKbps)
+	}
+	return fmt.Sprintf("%s-%d-%d-%s", enc.Name(), sampleRate, channels, param)
+}
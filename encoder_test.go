@@ -0,0 +1,134 @@
+package main
+
+import "testing"
+
+func TestResolveEncoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		bitrate int
+		wantErr bool
+		check   func(t *testing.T, enc Encoder)
+	}{
+		{
+			name:   "empty defaults to wav",
+			target: "",
+			check: func(t *testing.T, enc Encoder) {
+				if enc.Name() != "wav" {
+					t.Fatalf("Name() = %q, want wav", enc.Name())
+				}
+			},
+		},
+		{
+			name:   "mp3 default quality",
+			target: "mp3",
+			check: func(t *testing.T, enc Encoder) {
+				e, ok := enc.(mp3Encoder)
+				if !ok || e.VBRQuality != defaultMP3Quality {
+					t.Fatalf("got %#v, want mp3Encoder{VBRQuality: %d}", enc, defaultMP3Quality)
+				}
+			},
+		},
+		{
+			name:    "mp3 custom quality",
+			target:  "mp3",
+			bitrate: 2,
+			check: func(t *testing.T, enc Encoder) {
+				e, ok := enc.(mp3Encoder)
+				if !ok || e.VBRQuality != 2 {
+					t.Fatalf("got %#v, want mp3Encoder{VBRQuality: 2}", enc)
+				}
+			},
+		},
+		{
+			name:    "mp3 quality out of range",
+			target:  "mp3",
+			bitrate: 10,
+			wantErr: true,
+		},
+		{
+			name:   "opus default bitrate",
+			target: "opus",
+			check: func(t *testing.T, enc Encoder) {
+				e, ok := enc.(opusEncoder)
+				if !ok || e.BitrateKbps != defaultOpusBitrate {
+					t.Fatalf("got %#v, want opusEncoder{BitrateKbps: %d}", enc, defaultOpusBitrate)
+				}
+			},
+		},
+		{
+			name:    "opus custom bitrate",
+			target:  "opus",
+			bitrate: 96,
+			check: func(t *testing.T, enc Encoder) {
+				e, ok := enc.(opusEncoder)
+				if !ok || e.BitrateKbps != 96 {
+					t.Fatalf("got %#v, want opusEncoder{BitrateKbps: 96}", enc)
+				}
+			},
+		},
+		{
+			name:   "flac",
+			target: "flac",
+			check: func(t *testing.T, enc Encoder) {
+				if enc.Name() != "flac" {
+					t.Fatalf("Name() = %q, want flac", enc.Name())
+				}
+			},
+		},
+		{
+			name:    "unsupported format",
+			target:  "aiff",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := resolveEncoder(tc.target, tc.bitrate)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("resolveEncoder(%q, %d) = %v, want error", tc.target, tc.bitrate, enc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveEncoder(%q, %d) unexpected error: %v", tc.target, tc.bitrate, err)
+			}
+			tc.check(t, enc)
+		})
+	}
+}
+
+func TestEncoderFingerprintDistinguishesParams(t *testing.T) {
+	q4 := encoderFingerprint(mp3Encoder{VBRQuality: 4}, 16000, 1)
+	q5 := encoderFingerprint(mp3Encoder{VBRQuality: 5}, 16000, 1)
+	if q4 == q5 {
+		t.Fatalf("fingerprints for differing mp3 quality collided: %q", q4)
+	}
+
+	wav := encoderFingerprint(wavEncoder{}, 16000, 1)
+	wavStereo := encoderFingerprint(wavEncoder{}, 16000, 2)
+	if wav == wavStereo {
+		t.Fatalf("fingerprints for differing channel counts collided: %q", wav)
+	}
+}
+
+func TestEncoderNameFromMIME(t *testing.T) {
+	tests := []struct {
+		mime string
+		want string
+	}{
+		{"audio/mpeg", "mp3"},
+		{"audio/mp3", "mp3"},
+		{"audio/flac", "flac"},
+		{"audio/ogg", "opus"},
+		{"audio/wav", "wav"},
+		{"application/octet-stream", ""},
+	}
+	for _, tc := range tests {
+		if got := encoderNameFromMIME(tc.mime); got != tc.want {
+			t.Errorf("encoderNameFromMIME(%q) = %q, want %q", tc.mime, got, tc.want)
+		}
+	}
+}
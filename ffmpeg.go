@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processJob runs ffmpeg for a queued job, reporting percent-complete as it
+// goes and finalizing the job's status once ffmpeg exits.
+func processJob(job *Job) {
+	defer job.cancel()
+	defer os.Remove(job.inputPath)
+	job.setProgress(JobRunning, 0)
+
+	fileID := job.inputHash + "_" + encoderFingerprint(job.encoder, job.sampleRate, job.channels)
+	if job.loudnorm {
+		fileID += "_" + loudnormFingerprint(job.loudnormTarget)
+	}
+	key := fileID + job.encoder.Ext()
+
+	if store.Exists(key) {
+		fileIndex.put(fileID, fileRecord{key: key, mime: job.encoder.MIME()})
+		job.finish(fileID, key, existingSize(key))
+		return
+	}
+
+	// duration was already probed in jobsHandler; a zero value (ffprobe
+	// couldn't determine it) just disables percent-complete reporting
+	// below rather than failing the job.
+	duration := job.originalDuration
+
+	var loudnessFilter string
+	if job.loudnorm {
+		measurement, err := measureLoudness(job.ctx, job.inputPath, job.loudnormTarget)
+		if err != nil {
+			job.fail("LOUDNESS_MEASUREMENT_FAILED", err)
+			return
+		}
+		job.setMeasurement(measurement)
+		loudnessFilter = loudnormFilter(job.loudnormTarget, measurement)
+	}
+
+	input, err := os.Open(job.inputPath)
+	if err != nil {
+		job.fail("IO_ERROR", err)
+		return
+	}
+	defer input.Close()
+
+	tmpOutput := filepath.Join(os.TempDir(), key+".tmp")
+	outFile, err := os.Create(tmpOutput)
+	if err != nil {
+		job.fail("IO_ERROR", err)
+		return
+	}
+
+	args := []string{"-y", "-loglevel", "error", "-i", "pipe:0", "-progress", "pipe:2"}
+	if loudnessFilter != "" {
+		args = append(args, "-af", loudnessFilter)
+	}
+	args = append(args, job.encoder.FFmpegArgs(job.sampleRate, job.channels)...)
+	args = append(args, "pipe:1")
+	cmd := exec.CommandContext(job.ctx, "ffmpeg", args...)
+	cmd.Stdin = input
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		outFile.Close()
+		os.Remove(tmpOutput)
+		job.fail("IO_ERROR", err)
+		return
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		outFile.Close()
+		os.Remove(tmpOutput)
+		job.fail("IO_ERROR", err)
+		return
+	}
+
+	var errBuf bytes.Buffer
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if percent, ok := parseProgressLine(line, duration); ok {
+				job.setProgress(JobRunning, percent)
+				continue
+			}
+			errBuf.WriteString(line)
+			errBuf.WriteByte('\n')
+		}
+	}()
+
+	outHasher := sha256.New()
+	stdoutDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(outFile, io.TeeReader(stdout, outHasher))
+		stdoutDone <- err
+	}()
+
+	if err := cmd.Start(); err != nil {
+		outFile.Close()
+		os.Remove(tmpOutput)
+		job.fail("IO_ERROR", err)
+		return
+	}
+	// cmd.StdoutPipe/StderrPipe document that Wait must not be called
+	// until all reads from the pipes have completed: Wait closes the
+	// pipes' read ends as soon as the process exits, racing the
+	// goroutines below. Drain them first, then Wait.
+	<-stderrDone
+	copyErr := <-stdoutDone
+	err = cmd.Wait()
+	outFile.Close()
+
+	if err != nil {
+		os.Remove(tmpOutput)
+		if job.ctx.Err() == context.DeadlineExceeded {
+			job.fail("TIMEOUT", fmt.Errorf("ffmpeg timed out"))
+		} else if job.ctx.Err() == context.Canceled {
+			job.fail("CANCELLED", fmt.Errorf("request cancelled"))
+		} else {
+			job.fail("FFMPEG_FAILED", fmt.Errorf("ffmpeg failed: %s", errBuf.String()))
+		}
+		return
+	}
+	if copyErr != nil {
+		os.Remove(tmpOutput)
+		job.fail("IO_ERROR", copyErr)
+		return
+	}
+
+	log.Printf("job %s: output sha256 %x", job.ID, outHasher.Sum(nil))
+
+	info, err := os.Stat(tmpOutput)
+	if err != nil {
+		job.fail("IO_ERROR", err)
+		return
+	}
+	if info.Size() == 0 {
+		os.Remove(tmpOutput)
+		job.fail("EMPTY_OUTPUT", fmt.Errorf("ffmpeg produced empty output"))
+		return
+	}
+
+	size := info.Size()
+	if err := store.Put(key, tmpOutput); err != nil {
+		os.Remove(tmpOutput)
+		job.fail("IO_ERROR", err)
+		return
+	}
+
+	fileIndex.put(fileID, fileRecord{key: key, mime: job.encoder.MIME()})
+	job.finish(fileID, key, size)
+}
+
+// existingSize returns the size in bytes of an already-stored key, for
+// surfacing in the response on a cache hit. Best-effort: storage
+// backends that can't report size cheaply (without fetching the whole
+// object) return 0.
+func existingSize(key string) int64 {
+	if ls, ok := store.(*LocalStorage); ok {
+		if info, err := os.Stat(ls.path(key)); err == nil {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// parseProgressLine interprets a single line of ffmpeg's `-progress`
+// output, returning the percent-complete derived from out_time_us once
+// total duration is known.
+func parseProgressLine(line string, totalDuration float64) (float64, bool) {
+	key, value, found := strings.Cut(line, "=")
+	if !found || key != "out_time_us" || totalDuration <= 0 {
+		return 0, false
+	}
+	outTimeUs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	percent := (float64(outTimeUs) / 1e6) / totalDuration * 100
+	if percent > 100 {
+		percent = 100
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	return percent, true
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fileRecord is what the file index needs to serve a normalized output:
+// its storage key and the MIME type of the encoder that produced it.
+type fileRecord struct {
+	key  string
+	mime string
+}
+
+// fileIndexT is the shared, mutex-protected map from file ID to the
+// normalized output it identifies. It's populated as jobs finish.
+//
+// This index is in-process memory only: it is not persisted or shared
+// across instances. A fileId therefore only resolves on whichever
+// process produced it — a restart, or a second instance behind a load
+// balancer, returns FILE_NOT_FOUND for a file that still exists in
+// storage. Running multiple instances requires either sticky routing by
+// fileId or moving this index into a shared store (e.g. the same
+// database that would back a multi-instance jobRegistry).
+type fileIndexT struct {
+	mu    sync.Mutex
+	files map[string]fileRecord
+}
+
+func (fi *fileIndexT) put(id string, rec fileRecord) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.files[id] = rec
+}
+
+func (fi *fileIndexT) get(id string) (fileRecord, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	rec, ok := fi.files[id]
+	return rec, ok
+}
+
+var fileIndex = &fileIndexT{files: make(map[string]fileRecord)}
+
+// filesHandler serves GET /v1/files/{fileId}, the normalized output for a
+// completed job, with full HTTP Range support (single and multipart byte
+// ranges) so clients can seek without downloading the whole file.
+//
+// fileId resolution goes through the in-process fileIndex (see its doc
+// comment), so this only serves files produced by this instance.
+func filesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, 405, "METHOD_NOT_ALLOWED", "only GET and HEAD are supported")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/files/")
+	if id == "" || strings.ContainsAny(id, "/\\") {
+		httpError(w, 400, "INVALID_ID", "invalid file id")
+		return
+	}
+
+	rec, ok := fileIndex.get(id)
+	if !ok {
+		httpError(w, 404, "FILE_NOT_FOUND", "no normalized file with that id")
+		return
+	}
+
+	// Backends that can mint presigned URLs (e.g. S3Storage) redirect
+	// there instead of proxying bytes through this process.
+	if url, err := store.PresignGet(rec.key, DefaultPresignTTL); err == nil {
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	ls, ok := store.(*LocalStorage)
+	if !ok {
+		httpError(w, 500, "UNSUPPORTED_STORAGE", "storage backend does not support direct downloads")
+		return
+	}
+
+	f, err := os.Open(ls.path(rec.key))
+	if err != nil {
+		httpError(w, 404, "FILE_NOT_FOUND", "no normalized file with that id")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		httpError(w, 500, "STAT_FAILED", err.Error())
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", rec.mime)
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		if r.Method == http.MethodGet {
+			io.Copy(w, f)
+		}
+		return
+	}
+
+	ranges, err := parseRanges(rangeHeader, info.Size())
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size()))
+		httpError(w, http.StatusRequestedRangeNotSatisfiable, "INVALID_RANGE", err.Error())
+		return
+	}
+
+	if len(ranges) == 1 {
+		serveSingleRange(w, r, f, ranges[0], info.Size())
+		return
+	}
+	serveMultipartRanges(w, r, f, ranges, info.Size(), rec.mime)
+}
+
+type byteRange struct {
+	start, length int64
+}
+
+// parseRanges parses an HTTP Range header of the form "bytes=a-b,c-d"
+// into a set of concrete, validated byte ranges.
+func parseRanges(header string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, fmt.Errorf("unsupported range unit")
+	}
+	var ranges []byteRange
+	for _, part := range strings.Split(strings.TrimPrefix(header, prefix), ",") {
+		part = strings.TrimSpace(part)
+		dash := strings.IndexByte(part, '-')
+		if dash < 0 {
+			return nil, fmt.Errorf("malformed range %q", part)
+		}
+		startStr, endStr := part[:dash], part[dash+1:]
+
+		var start, end int64
+		if startStr == "" {
+			// Suffix range: "-N" means the last N bytes.
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed range %q", part)
+			}
+			if n > size {
+				n = size
+			}
+			start = size - n
+			end = size - 1
+		} else {
+			s, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed range %q", part)
+			}
+			start = s
+			if endStr == "" {
+				end = size - 1
+			} else {
+				e, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("malformed range %q", part)
+				}
+				end = e
+			}
+		}
+
+		if start < 0 || start >= size || end < start {
+			return nil, fmt.Errorf("range out of bounds")
+		}
+		if end >= size {
+			end = size - 1
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges specified")
+	}
+	return ranges, nil
+}
+
+func serveSingleRange(w http.ResponseWriter, r *http.Request, f *os.File, rng byteRange, size int64) {
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.start+rng.length-1, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(rng.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return
+	}
+	copyRange(w, f, rng)
+}
+
+func serveMultipartRanges(w http.ResponseWriter, r *http.Request, f *os.File, ranges []byteRange, size int64, mime string) {
+	pw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+pw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	for _, rng := range ranges {
+		part, err := pw.CreatePart(map[string][]string{
+			"Content-Type":  {mime},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.start+rng.length-1, size)},
+		})
+		if err != nil {
+			return
+		}
+		copyRange(part, f, rng)
+	}
+	pw.Close()
+}
+
+// copyRange streams exactly rng.length bytes from f starting at rng.start
+// into dst.
+func copyRange(dst io.Writer, f *os.File, rng byteRange) {
+	section := io.NewSectionReader(f, rng.start, rng.length)
+	io.Copy(dst, section)
+}
@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestParseRanges(t *testing.T) {
+	const size = int64(1000)
+
+	tests := []struct {
+		name    string
+		header  string
+		want    []byteRange
+		wantErr bool
+	}{
+		{
+			name:   "single range",
+			header: "bytes=0-99",
+			want:   []byteRange{{start: 0, length: 100}},
+		},
+		{
+			name:   "open-ended range",
+			header: "bytes=900-",
+			want:   []byteRange{{start: 900, length: 100}},
+		},
+		{
+			name:   "suffix range",
+			header: "bytes=-100",
+			want:   []byteRange{{start: 900, length: 100}},
+		},
+		{
+			name:   "suffix range larger than file clamps to whole file",
+			header: "bytes=-5000",
+			want:   []byteRange{{start: 0, length: 1000}},
+		},
+		{
+			name:   "end beyond size clamps to last byte",
+			header: "bytes=0-5000",
+			want:   []byteRange{{start: 0, length: 1000}},
+		},
+		{
+			name:   "multiple ranges",
+			header: "bytes=0-99,200-299",
+			want: []byteRange{
+				{start: 0, length: 100},
+				{start: 200, length: 100},
+			},
+		},
+		{
+			name:    "wrong unit",
+			header:  "items=0-99",
+			wantErr: true,
+		},
+		{
+			name:    "malformed range",
+			header:  "bytes=abc",
+			wantErr: true,
+		},
+		{
+			name:    "start past end of file",
+			header:  "bytes=1000-1099",
+			wantErr: true,
+		},
+		{
+			name:    "start after end",
+			header:  "bytes=500-100",
+			wantErr: true,
+		},
+		{
+			name:    "empty ranges list",
+			header:  "bytes=",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRanges(tc.header, size)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseRanges(%q) = %v, want error", tc.header, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRanges(%q) unexpected error: %v", tc.header, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("parseRanges(%q) = %v, want %v", tc.header, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("parseRanges(%q)[%d] = %+v, want %+v", tc.header, i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job tracks a single normalize request from upload through completion.
+// Its fields below the mutex are mutated by the worker goroutine and read
+// by the status/events handlers, so all access must go through the
+// accessor methods.
+type Job struct {
+	ID        string
+	Original  string
+	CreatedAt time.Time
+
+	ctx            context.Context
+	cancel         context.CancelFunc
+	inputPath      string
+	inputHash      string
+	encoder        Encoder
+	sampleRate     int
+	channels       int
+	loudnorm       bool
+	loudnormTarget LoudnormTarget
+
+	originalCodec      string
+	originalSampleRate int
+	originalChannels   int
+	originalDuration   float64
+	originalBitrate    int64
+
+	mu          sync.Mutex
+	status      JobStatus
+	percent     float64
+	fileID      string
+	storageKey  string
+	sizeBytes   int64
+	errCode     string
+	err         error
+	measured    *LoudnormMeasurement
+	subscribers map[chan struct{}]struct{}
+}
+
+func (j *Job) setProgress(status JobStatus, percent float64) {
+	j.mu.Lock()
+	j.status = status
+	j.percent = percent
+	j.mu.Unlock()
+	j.notify()
+}
+
+func (j *Job) fail(code string, err error) {
+	j.mu.Lock()
+	j.status = JobFailed
+	j.errCode = code
+	j.err = err
+	j.mu.Unlock()
+	j.notify()
+}
+
+func (j *Job) setMeasurement(m LoudnormMeasurement) {
+	j.mu.Lock()
+	j.measured = &m
+	j.mu.Unlock()
+}
+
+func (j *Job) measurement() *LoudnormMeasurement {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.measured
+}
+
+func (j *Job) finish(fileID, storageKey string, size int64) {
+	j.mu.Lock()
+	j.status = JobDone
+	j.percent = 100
+	j.fileID = fileID
+	j.storageKey = storageKey
+	j.sizeBytes = size
+	j.mu.Unlock()
+	j.notify()
+}
+
+func (j *Job) snapshot() (status JobStatus, percent float64, fileID, storageKey string, sizeBytes int64, errCode string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.percent, j.fileID, j.storageKey, j.sizeBytes, j.errCode, j.err
+}
+
+func (j *Job) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	j.mu.Lock()
+	j.subscribers[ch] = struct{}{}
+	j.mu.Unlock()
+	return ch
+}
+
+func (j *Job) unsubscribe(ch chan struct{}) {
+	j.mu.Lock()
+	delete(j.subscribers, ch)
+	j.mu.Unlock()
+}
+
+func (j *Job) notify() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for ch := range j.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// jobRegistry is the shared, mutex-protected map of in-flight and
+// completed jobs, keyed by job ID.
+//
+// Like fileIndex (files.go), this lives only in process memory: a job
+// is only queryable from the instance that accepted its upload. A
+// restart, or a second instance behind a load balancer, 404s on a job
+// ID that was handed out moments earlier even though the normalized
+// output may already be durably stored. Scaling past one instance needs
+// this moved into a shared store keyed by job ID.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func (r *jobRegistry) put(job *Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = job
+}
+
+func (r *jobRegistry) get(id string) (*Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	return job, ok
+}
+
+var jobs = &jobRegistry{jobs: make(map[string]*Job)}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// jobsHandler handles POST /v1/jobs: it accepts the upload, registers a
+// Job, enqueues it for a worker, and returns immediately.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, 405, "METHOD_NOT_ALLOWED", "only POST is supported")
+		return
+	}
+
+	// r.ParseMultipartForm has no size cap of its own: without this,
+	// mime/multipart spools an arbitrarily large file part to disk
+	// before spoolUpload's MaxBytes check ever runs. MaxBytesReader
+	// aborts the read (and the underlying TCP connection) as soon as
+	// the body exceeds the limit, so the cap applies before any of it
+	// hits disk.
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBytes+maxFormMemory)
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpError(w, 400, "FILE_TOO_LARGE", fmt.Sprintf("upload exceeds the %d byte limit", MaxBytes))
+		} else {
+			httpError(w, 400, "INVALID_FORM", err.Error())
+		}
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		httpError(w, 400, "NO_FILE", "missing file field")
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+
+	inputPath, inputHash, err := spoolUpload(file, ext)
+	if err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			httpError(w, 400, "FILE_TOO_LARGE", fmt.Sprintf("upload exceeds the %d byte limit", MaxBytes))
+		} else {
+			httpError(w, 500, "READ_FAILED", err.Error())
+		}
+		return
+	}
+	keepInput := false
+	defer func() {
+		if !keepInput {
+			os.Remove(inputPath)
+		}
+	}()
+
+	probeCtx, probeCancel := context.WithTimeout(r.Context(), 10*time.Second)
+	probed, err := probeFile(probeCtx, inputPath)
+	probeCancel()
+	if err != nil {
+		httpError(w, 400, "PROBE_FAILED", fmt.Sprintf("could not inspect uploaded file: %v", err))
+		return
+	}
+	audioStream, err := selectAudioStream(probed)
+	if err != nil {
+		httpError(w, 400, "UNSUPPORTED_CODEC", err.Error())
+		return
+	}
+
+	targetName := r.FormValue("target")
+	if targetName == "" {
+		targetName = encoderNameFromMIME(r.Header.Get("Accept"))
+	}
+
+	bitrate := 0
+	if v := r.FormValue("bitrate"); v != "" {
+		b, err := strconv.Atoi(v)
+		if err != nil {
+			httpError(w, 400, "INVALID_PARAM", "bitrate must be an integer")
+			return
+		}
+		bitrate = b
+	}
+
+	encoder, err := resolveEncoder(targetName, bitrate)
+	if err != nil {
+		httpError(w, 400, "UNSUPPORTED_FORMAT", err.Error())
+		return
+	}
+
+	sampleRate := SampleRate
+	if v := r.FormValue("sampleRate"); v != "" {
+		sr, err := strconv.Atoi(v)
+		if err != nil || sr <= 0 {
+			httpError(w, 400, "INVALID_PARAM", "sampleRate must be a positive integer")
+			return
+		}
+		sampleRate = sr
+	}
+
+	channels := 1
+	if v := r.FormValue("channels"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil || c <= 0 {
+			httpError(w, 400, "INVALID_PARAM", "channels must be a positive integer")
+			return
+		}
+		channels = c
+	}
+
+	loudnorm := r.FormValue("loudnorm") == "true" || r.FormValue("loudnorm") == "1"
+	loudnormTarget := DefaultLoudnormTarget
+	if loudnorm {
+		t, err := parseLoudnormTarget(r)
+		if err != nil {
+			httpError(w, 400, "INVALID_PARAM", err.Error())
+			return
+		}
+		loudnormTarget = t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	job := &Job{
+		ID:             newJobID(),
+		Original:       header.Filename,
+		CreatedAt:      time.Now(),
+		ctx:            ctx,
+		cancel:         cancel,
+		inputPath:      inputPath,
+		inputHash:      inputHash,
+		encoder:        encoder,
+		sampleRate:     sampleRate,
+		channels:       channels,
+		loudnorm:       loudnorm,
+		loudnormTarget: loudnormTarget,
+
+		originalCodec:      audioStream.CodecName,
+		originalSampleRate: parseProbeInt(audioStream.SampleRate),
+		originalChannels:   audioStream.Channels,
+		originalDuration:   parseProbeFloat(probed.Format.Duration),
+		originalBitrate:    int64(parseProbeInt(probed.Format.BitRate)),
+
+		status:      JobQueued,
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+	keepInput = true
+	jobs.put(job)
+	jobQueue <- job
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/jobs/%s", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jobId":    job.ID,
+		"status":   JobQueued,
+		"location": fmt.Sprintf("/v1/jobs/%s", job.ID),
+		"original": originalMetadata(job),
+	})
+}
+
+// originalMetadata summarizes the ffprobe results captured for a job's
+// upload at request time, for inclusion alongside the original filename
+// in API responses.
+func originalMetadata(job *Job) map[string]any {
+	return map[string]any{
+		"filename":    job.Original,
+		"codec":       job.originalCodec,
+		"sampleRate":  job.originalSampleRate,
+		"channels":    job.originalChannels,
+		"durationSec": job.originalDuration,
+		"bitrate":     job.originalBitrate,
+	}
+}
+
+// jobByIDHandler handles GET /v1/jobs/{id} and GET /v1/jobs/{id}/events.
+func jobByIDHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	if rest == "" {
+		httpError(w, 404, "NOT_FOUND", "missing job id")
+		return
+	}
+
+	if id, ok := strings.CutSuffix(rest, "/events"); ok {
+		jobEventsHandler(w, r, id)
+		return
+	}
+
+	job, ok := jobs.get(rest)
+	if !ok {
+		httpError(w, 404, "JOB_NOT_FOUND", "no job with that id")
+		return
+	}
+
+	writeJobStatus(w, job)
+}
+
+func writeJobStatus(w http.ResponseWriter, job *Job) {
+	status, percent, fileID, storageKey, sizeBytes, errCode, jobErr := job.snapshot()
+
+	resp := map[string]any{
+		"jobId":           job.ID,
+		"status":          status,
+		"percentComplete": percent,
+		"original":        originalMetadata(job),
+	}
+	if jobErr != nil {
+		resp["error"] = map[string]any{
+			"code":    errCode,
+			"message": jobErr.Error(),
+		}
+	}
+	if status == JobDone {
+		normalized := map[string]any{
+			"fileId":     fileID,
+			"filename":   storageKey,
+			"sampleRate": job.sampleRate,
+			"channels":   job.channels,
+			"encoding":   job.encoder.Name(),
+			"mimeType":   job.encoder.MIME(),
+			"sizeBytes":  sizeBytes,
+		}
+		if job.loudnorm {
+			normalized["loudness"] = loudnormResponse(job)
+		}
+		if url, err := store.PresignGet(storageKey, DefaultPresignTTL); err == nil {
+			normalized["downloadUrl"] = url
+		}
+		resp["metadata"] = normalized
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// jobEventsHandler streams progress as Server-Sent Events until the job
+// reaches a terminal state.
+func jobEventsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := jobs.get(id)
+	if !ok {
+		httpError(w, 404, "JOB_NOT_FOUND", "no job with that id")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, 500, "STREAMING_UNSUPPORTED", "server does not support streaming")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := job.subscribe()
+	defer job.unsubscribe(ch)
+
+	writeEvent := func() bool {
+		status, percent, _, _, _, errCode, jobErr := job.snapshot()
+		payload := map[string]any{"status": status, "percentComplete": percent}
+		if jobErr != nil {
+			payload["error"] = map[string]any{
+				"code":    errCode,
+				"message": jobErr.Error(),
+			}
+		}
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		return status == JobDone || status == JobFailed
+	}
+
+	if writeEvent() {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			if writeEvent() {
+				return
+			}
+		}
+	}
+}
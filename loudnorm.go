@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// LoudnormTarget holds the EBU R128 targets for a loudnorm pass:
+// integrated loudness (I), true peak (TP), and loudness range (LRA),
+// all in the units ffmpeg's loudnorm filter expects.
+type LoudnormTarget struct {
+	I   float64
+	TP  float64
+	LRA float64
+}
+
+// DefaultLoudnormTarget matches ffmpeg's own loudnorm defaults and the
+// EBU R128 recommendation.
+var DefaultLoudnormTarget = LoudnormTarget{I: -16, TP: -1.5, LRA: 11}
+
+// LoudnormMeasurement is the first-pass loudnorm JSON report, parsed from
+// ffmpeg's stderr. ffmpeg prints each field as a JSON string, not a
+// number, hence the string-typed fields below.
+type LoudnormMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+func parseLoudnormTarget(r *http.Request) (LoudnormTarget, error) {
+	target := DefaultLoudnormTarget
+
+	if v := r.FormValue("I"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return target, fmt.Errorf("I must be a number")
+		}
+		target.I = f
+	}
+	if v := r.FormValue("TP"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return target, fmt.Errorf("TP must be a number")
+		}
+		target.TP = f
+	}
+	if v := r.FormValue("LRA"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return target, fmt.Errorf("LRA must be a number")
+		}
+		target.LRA = f
+	}
+	return target, nil
+}
+
+// measureLoudness runs ffmpeg's loudnorm filter in its measurement-only
+// mode (print_format=json, output discarded to -f null) and parses the
+// JSON report it prints to stderr.
+func measureLoudness(ctx context.Context, path string, target LoudnormTarget) (LoudnormMeasurement, error) {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", target.I, target.TP, target.LRA)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", path, "-af", filter, "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Run() // non-zero exit with -f null is common; we only care about the report
+
+	start := bytes.IndexByte(stderr.Bytes(), '{')
+	end := bytes.LastIndexByte(stderr.Bytes(), '}')
+	if start < 0 || end < start {
+		return LoudnormMeasurement{}, fmt.Errorf("loudnorm measurement failed: no report in ffmpeg output")
+	}
+
+	var m LoudnormMeasurement
+	if err := json.Unmarshal(stderr.Bytes()[start:end+1], &m); err != nil {
+		return LoudnormMeasurement{}, fmt.Errorf("loudnorm measurement failed: %w", err)
+	}
+	if m.InputI == "" || strings.Contains(strings.ToLower(m.InputI), "inf") {
+		return LoudnormMeasurement{}, fmt.Errorf("loudnorm measurement failed: input has no measurable loudness (silence?)")
+	}
+	return m, nil
+}
+
+// loudnormFilter builds the second-pass loudnorm filter string, feeding
+// the first pass's measurement back in via measured_* so ffmpeg applies
+// a single linear gain instead of re-measuring.
+func loudnormFilter(target LoudnormTarget, m LoudnormMeasurement) string {
+	return fmt.Sprintf(
+		"loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=summary",
+		target.I, target.TP, target.LRA,
+		m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset,
+	)
+}
+
+// loudnormFingerprint folds a loudnorm target into the cache key so
+// differing I/TP/LRA targets don't collide in StorageDir.
+func loudnormFingerprint(target LoudnormTarget) string {
+	return fmt.Sprintf("ln%g-%g-%g", target.I, target.TP, target.LRA)
+}
+
+func loudnormResponse(job *Job) map[string]any {
+	resp := map[string]any{
+		"target": map[string]any{
+			"I":   job.loudnormTarget.I,
+			"TP":  job.loudnormTarget.TP,
+			"LRA": job.loudnormTarget.LRA,
+		},
+	}
+	if m := job.measurement(); m != nil {
+		resp["measured"] = map[string]any{
+			"inputI":       m.InputI,
+			"inputTP":      m.InputTP,
+			"inputLRA":     m.InputLRA,
+			"inputThresh":  m.InputThresh,
+			"targetOffset": m.TargetOffset,
+		}
+	}
+	return resp
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func formRequest(t *testing.T, values url.Values) *http.Request {
+	t.Helper()
+	r, err := http.NewRequest(http.MethodPost, "/v1/jobs?"+values.Encode(), nil)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	return r
+}
+
+func TestParseLoudnormTarget(t *testing.T) {
+	t.Run("defaults when unset", func(t *testing.T) {
+		got, err := parseLoudnormTarget(formRequest(t, url.Values{}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != DefaultLoudnormTarget {
+			t.Fatalf("got %+v, want default %+v", got, DefaultLoudnormTarget)
+		}
+	})
+
+	t.Run("overrides individual fields", func(t *testing.T) {
+		got, err := parseLoudnormTarget(formRequest(t, url.Values{
+			"I": {"-20"},
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := DefaultLoudnormTarget
+		want.I = -20
+		if got != want {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("rejects non-numeric TP", func(t *testing.T) {
+		if _, err := parseLoudnormTarget(formRequest(t, url.Values{
+			"TP": {"loud"},
+		})); err == nil {
+			t.Fatal("expected error for non-numeric TP")
+		}
+	})
+
+	t.Run("rejects non-numeric LRA", func(t *testing.T) {
+		if _, err := parseLoudnormTarget(formRequest(t, url.Values{
+			"LRA": {"wide"},
+		})); err == nil {
+			t.Fatal("expected error for non-numeric LRA")
+		}
+	})
+}
+
+func TestLoudnormFingerprintDistinguishesTargets(t *testing.T) {
+	a := loudnormFingerprint(LoudnormTarget{I: -16, TP: -1.5, LRA: 11})
+	b := loudnormFingerprint(LoudnormTarget{I: -20, TP: -1.5, LRA: 11})
+	if a == b {
+		t.Fatalf("fingerprints for differing I targets collided: %q", a)
+	}
+}
+
+func TestLoudnormFilterIncludesMeasurement(t *testing.T) {
+	target := LoudnormTarget{I: -16, TP: -1.5, LRA: 11}
+	m := LoudnormMeasurement{
+		InputI:       "-23.00",
+		InputTP:      "-5.00",
+		InputLRA:     "4.00",
+		InputThresh:  "-33.00",
+		TargetOffset: "0.50",
+	}
+	filter := loudnormFilter(target, m)
+	for _, want := range []string{"measured_I=-23.00", "measured_TP=-5.00", "offset=0.50", "linear=true"} {
+		if !strings.Contains(filter, want) {
+			t.Errorf("loudnormFilter() = %q, want substring %q", filter, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ProbeFormat is the `format` section of ffprobe's JSON report.
+type ProbeFormat struct {
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"`
+	BitRate    string `json:"bit_rate"`
+}
+
+// ProbeStream is one entry of ffprobe's `streams` array. ffprobe emits
+// many more fields than this; only the ones the service acts on are
+// extracted here.
+type ProbeStream struct {
+	CodecType  string `json:"codec_type"`
+	CodecName  string `json:"codec_name"`
+	SampleRate string `json:"sample_rate"`
+	Channels   int    `json:"channels"`
+}
+
+// ProbeResult is ffprobe's full JSON report for a single file, as
+// produced by `-show_streams -show_format`.
+type ProbeResult struct {
+	Format  ProbeFormat   `json:"format"`
+	Streams []ProbeStream `json:"streams"`
+}
+
+// defaultAllowedCodecs lists the audio codecs accepted when a file is
+// uploaded, keyed by ffprobe's codec_name. Override with ALLOWED_CODECS
+// (comma-separated codec names) to widen or narrow this.
+var defaultAllowedCodecs = []string{
+	"mp3", "pcm_s16le", "pcm_s24le", "pcm_f32le", "flac", "vorbis", "opus", "aac",
+}
+
+// AllowedCodecs is the set of audio codec_names probeFile results are
+// checked against. Override with ALLOWED_CODECS.
+var AllowedCodecs = parseAllowedCodecs(os.Getenv("ALLOWED_CODECS"), defaultAllowedCodecs)
+
+func parseAllowedCodecs(v string, def []string) map[string]bool {
+	names := def
+	if v != "" {
+		names = strings.Split(v, ",")
+	}
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			set[n] = true
+		}
+	}
+	return set
+}
+
+// probeFile runs ffprobe against the file at path and parses its JSON
+// report, so uploads can be validated by their actual contents rather
+// than by filename extension.
+func probeFile(ctx context.Context, path string) (ProbeResult, error) {
+	out, err := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
+		path,
+	).Output()
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	var result ProbeResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		return ProbeResult{}, fmt.Errorf("parsing ffprobe output: %w", err)
+	}
+	return result, nil
+}
+
+// errUnsupportedCodec is returned by selectAudioStream when the probed
+// file has no audio stream whose codec is in AllowedCodecs.
+type errUnsupportedCodec struct {
+	codec string
+}
+
+func (e *errUnsupportedCodec) Error() string {
+	if e.codec == "" {
+		return "no audio stream found"
+	}
+	return fmt.Sprintf("unsupported codec %q", e.codec)
+}
+
+// selectAudioStream returns the first audio stream in result whose codec
+// is in AllowedCodecs, or an *errUnsupportedCodec naming the best
+// candidate it rejected along the way.
+func selectAudioStream(result ProbeResult) (ProbeStream, error) {
+	var rejected string
+	for _, s := range result.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		if AllowedCodecs[s.CodecName] {
+			return s, nil
+		}
+		rejected = s.CodecName
+	}
+	return ProbeStream{}, &errUnsupportedCodec{codec: rejected}
+}
+
+// parseProbeFloat and parseProbeInt tolerate the empty/"N/A" values
+// ffprobe emits for fields it couldn't determine, returning the zero
+// value rather than an error the caller would have to handle.
+func parseProbeFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func parseProbeInt(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
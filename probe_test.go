@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestSelectAudioStream(t *testing.T) {
+	t.Run("picks the first allowed audio stream", func(t *testing.T) {
+		result := ProbeResult{Streams: []ProbeStream{
+			{CodecType: "video", CodecName: "h264"},
+			{CodecType: "audio", CodecName: "mp3", SampleRate: "44100", Channels: 2},
+		}}
+		got, err := selectAudioStream(result)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.CodecName != "mp3" || got.Channels != 2 {
+			t.Fatalf("got %+v, want mp3/2ch", got)
+		}
+	})
+
+	t.Run("skips disallowed codecs to find an allowed one", func(t *testing.T) {
+		result := ProbeResult{Streams: []ProbeStream{
+			{CodecType: "audio", CodecName: "wmav2"},
+			{CodecType: "audio", CodecName: "flac"},
+		}}
+		got, err := selectAudioStream(result)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.CodecName != "flac" {
+			t.Fatalf("got codec %q, want flac", got.CodecName)
+		}
+	})
+
+	t.Run("rejects a file with no audio stream at all", func(t *testing.T) {
+		result := ProbeResult{Streams: []ProbeStream{
+			{CodecType: "video", CodecName: "h264"},
+		}}
+		_, err := selectAudioStream(result)
+		if err == nil {
+			t.Fatal("expected error for video-only input")
+		}
+	})
+
+	t.Run("rejects a file whose only audio stream is unsupported", func(t *testing.T) {
+		result := ProbeResult{Streams: []ProbeStream{
+			{CodecType: "audio", CodecName: "wmav2"},
+		}}
+		_, err := selectAudioStream(result)
+		if err == nil {
+			t.Fatal("expected error for unsupported codec")
+		}
+		uc, ok := err.(*errUnsupportedCodec)
+		if !ok {
+			t.Fatalf("got error type %T, want *errUnsupportedCodec", err)
+		}
+		if uc.codec != "wmav2" {
+			t.Fatalf("got rejected codec %q, want wmav2", uc.codec)
+		}
+	})
+}
+
+func TestParseAllowedCodecs(t *testing.T) {
+	t.Run("falls back to the default list when unset", func(t *testing.T) {
+		got := parseAllowedCodecs("", defaultAllowedCodecs)
+		if !got["mp3"] || !got["flac"] {
+			t.Fatalf("got %v, want defaults including mp3/flac", got)
+		}
+	})
+
+	t.Run("overrides the list when set", func(t *testing.T) {
+		got := parseAllowedCodecs("mp3, aac ", defaultAllowedCodecs)
+		if len(got) != 2 || !got["mp3"] || !got["aac"] {
+			t.Fatalf("got %v, want exactly {mp3, aac}", got)
+		}
+		if got["flac"] {
+			t.Fatal("override should not carry over defaults")
+		}
+	})
+}
+
+func TestParseProbeNumbers(t *testing.T) {
+	if got := parseProbeFloat("12.345"); got != 12.345 {
+		t.Errorf("parseProbeFloat(%q) = %v, want 12.345", "12.345", got)
+	}
+	if got := parseProbeFloat("N/A"); got != 0 {
+		t.Errorf("parseProbeFloat(%q) = %v, want 0", "N/A", got)
+	}
+	if got := parseProbeInt("44100"); got != 44100 {
+		t.Errorf("parseProbeInt(%q) = %v, want 44100", "44100", got)
+	}
+	if got := parseProbeInt(""); got != 0 {
+		t.Errorf("parseProbeInt(\"\") = %v, want 0", got)
+	}
+}
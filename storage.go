@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNotSupported is returned by PresignGet implementations (like
+// LocalStorage) that have no notion of a presigned URL.
+var errNotSupported = errors.New("operation not supported by this storage backend")
+
+// Storage abstracts where normalized outputs live once ffmpeg has
+// produced them, so the job pipeline doesn't need to know whether it's
+// talking to the local disk or an object store.
+type Storage interface {
+	Exists(key string) bool
+	Put(key, path string) error
+	PresignGet(key string, ttl time.Duration) (string, error)
+	Open(key string) (io.ReadCloser, error)
+}
+
+// LocalStorage keeps normalized outputs under a directory on local
+// disk, same as the original StorageDir-based behavior.
+type LocalStorage struct {
+	Dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	os.MkdirAll(dir, 0755)
+	return &LocalStorage{Dir: dir}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.Dir, key)
+}
+
+func (s *LocalStorage) Exists(key string) bool {
+	_, err := os.Stat(s.path(key))
+	return err == nil
+}
+
+// Put moves the file at path (typically a finished .tmp output) into
+// place under key via an atomic rename.
+func (s *LocalStorage) Put(key, path string) error {
+	return os.Rename(path, s.path(key))
+}
+
+// PresignGet isn't meaningful for local disk; callers fall back to
+// serving the file directly (see filesHandler).
+func (s *LocalStorage) PresignGet(key string, ttl time.Duration) (string, error) {
+	return "", errNotSupported
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errFileTooLarge is returned by limitedReader once the caller-supplied
+// byte ceiling is exceeded, so callers can distinguish it from a generic
+// read failure.
+var errFileTooLarge = errors.New("upload exceeds maximum allowed size")
+
+// limitedReader wraps r and fails with errFileTooLarge as soon as more
+// than max bytes have been read, rather than silently truncating like
+// io.LimitReader does.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func newLimitedReader(r io.Reader, max int64) *limitedReader {
+	return &limitedReader{r: r, remaining: max}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// progressReader logs cumulative bytes read through it no more often
+// than every logInterval, purely for observability on large uploads.
+type progressReader struct {
+	io.Reader
+	label       string
+	total       int64
+	lastLogged  time.Time
+	logInterval time.Duration
+}
+
+func newProgressReader(r io.Reader, label string) *progressReader {
+	return &progressReader{Reader: r, label: label, logInterval: 2 * time.Second}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.total += int64(n)
+	if time.Since(p.lastLogged) >= p.logInterval {
+		log.Printf("%s: %d bytes read", p.label, p.total)
+		p.lastLogged = time.Now()
+	}
+	return n, err
+}
+
+// spoolUpload streams file to a temp path under os.TempDir, enforcing
+// MaxBytes and hashing the content as it goes, in a single pass: no
+// io.ReadAll into memory and no separate os.WriteFile copy afterwards.
+// It returns the spooled path and the hex-encoded SHA-256 of its
+// contents, which doubles as the cache key input for processJob.
+func spoolUpload(file multipart.File, ext string) (path string, hash string, err error) {
+	out, err := os.CreateTemp(os.TempDir(), "upload-*"+ext)
+	if err != nil {
+		return "", "", err
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	reader := newProgressReader(newLimitedReader(file, MaxBytes), "upload")
+	if _, err := io.Copy(out, io.TeeReader(reader, hasher)); err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	return filepath.Clean(out.Name()), hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLimitedReader(t *testing.T) {
+	t.Run("passes through reads under the limit", func(t *testing.T) {
+		lr := newLimitedReader(strings.NewReader("hello"), 10)
+		got, err := io.ReadAll(lr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != "hello" {
+			t.Fatalf("got %q, want %q", got, "hello")
+		}
+	})
+
+	t.Run("allows exactly the limit", func(t *testing.T) {
+		lr := newLimitedReader(strings.NewReader("hello"), 5)
+		got, err := io.ReadAll(lr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != "hello" {
+			t.Fatalf("got %q, want %q", got, "hello")
+		}
+	})
+
+	t.Run("fails once more than the limit is read", func(t *testing.T) {
+		lr := newLimitedReader(strings.NewReader("hello world"), 5)
+		_, err := io.ReadAll(lr)
+		if !errors.Is(err, errFileTooLarge) {
+			t.Fatalf("got err %v, want errFileTooLarge", err)
+		}
+	})
+}
+
+// fakeMultipartFile adapts a bytes.Reader to the multipart.File
+// interface (io.Reader + io.ReaderAt + io.Seeker + io.Closer) that
+// spoolUpload accepts.
+type fakeMultipartFile struct {
+	*bytes.Reader
+}
+
+func (fakeMultipartFile) Close() error { return nil }
+
+func newFakeMultipartFile(data []byte) fakeMultipartFile {
+	return fakeMultipartFile{bytes.NewReader(data)}
+}
+
+func TestSpoolUpload(t *testing.T) {
+	t.Run("spools content to disk and hashes it", func(t *testing.T) {
+		data := []byte("some audio bytes")
+		path, hash, err := spoolUpload(newFakeMultipartFile(data), ".wav")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer os.Remove(path)
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading spooled file: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("spooled content = %q, want %q", got, data)
+		}
+		if !strings.HasSuffix(path, ".wav") {
+			t.Fatalf("spooled path %q does not have .wav suffix", path)
+		}
+		if hash == "" {
+			t.Fatal("expected non-empty hash")
+		}
+
+		_, hash2, err := spoolUpload(newFakeMultipartFile(data), ".wav")
+		if err != nil {
+			t.Fatalf("unexpected error on second spool: %v", err)
+		}
+		if hash != hash2 {
+			t.Fatalf("hash not deterministic: %q != %q", hash, hash2)
+		}
+	})
+
+	t.Run("rejects uploads over MaxBytes", func(t *testing.T) {
+		orig := MaxBytes
+		MaxBytes = 4
+		defer func() { MaxBytes = orig }()
+
+		path, _, err := spoolUpload(newFakeMultipartFile([]byte("too long")), ".wav")
+		if !errors.Is(err, errFileTooLarge) {
+			t.Fatalf("got err %v, want errFileTooLarge", err)
+		}
+		if path != "" {
+			t.Fatalf("expected no path on failure, got %q", path)
+		}
+	})
+}